@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+// notimplBoolValue implements flag.Value for boolean options that the
+// real git accepts but that this command doesn't do anything with
+// yet, so that scripts invoking dgit don't fail on an unknown flag.
+type notimplBoolValue struct{ v bool }
+
+func newNotimplBoolValue() *notimplBoolValue { return &notimplBoolValue{} }
+func (n *notimplBoolValue) String() string   { return fmt.Sprintf("%v", n.v) }
+func (n *notimplBoolValue) IsBoolFlag() bool { return true }
+func (n *notimplBoolValue) Set(s string) error {
+	switch s {
+	case "true", "":
+		n.v = true
+	case "false":
+		n.v = false
+	default:
+		return fmt.Errorf("invalid boolean value %q", s)
+	}
+	return nil
+}
+
+// notimplStringValue is the string-flag equivalent of
+// notimplBoolValue.
+type notimplStringValue struct{ v string }
+
+func newNotimplStringValue() *notimplStringValue { return &notimplStringValue{} }
+func (n *notimplStringValue) String() string      { return n.v }
+func (n *notimplStringValue) Set(s string) error  { n.v = s; return nil }
+
+// wordDiffValue implements flag.Value for --word-diff[=<mode>]: bare
+// "--word-diff" behaves like "--word-diff=plain", matching upstream.
+type wordDiffValue struct{ opt *git.DiffCommonOptions }
+
+func (w *wordDiffValue) String() string {
+	if w.opt == nil {
+		return ""
+	}
+	return string(w.opt.WordDiff)
+}
+func (w *wordDiffValue) IsBoolFlag() bool { return true }
+func (w *wordDiffValue) Set(s string) error {
+	switch s {
+	case "true", "plain", "":
+		w.opt.WordDiff = git.WordDiffPlain
+	case "color":
+		w.opt.WordDiff = git.WordDiffColor
+	case "porcelain":
+		w.opt.WordDiff = git.WordDiffPorcelain
+	case "false", "none":
+		w.opt.WordDiff = git.WordDiffNone
+	default:
+		return fmt.Errorf("invalid --word-diff mode %q", s)
+	}
+	if w.opt.WordDiff != git.WordDiffNone {
+		w.opt.Patch = true
+	}
+	return nil
+}
+
+// isTerminal reports whether f looks like an interactive terminal,
+// used to decide whether to default color-sensitive output on.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// parseCommonDiffFlags registers the flags shared by the diff family
+// of commands (diff, diff-files, diff-index) onto flags, parses args
+// against it, and fills in opt. color selects whether this command's
+// output is ever colorized, so commands that only ever print a raw
+// listing can pass false and skip the terminal check.
+func parseCommonDiffFlags(c *git.Client, opt *git.DiffCommonOptions, color bool, flags *flag.FlagSet, args []string) ([]string, error) {
+	flags.BoolVar(&opt.Patch, "patch", opt.Patch, "Generate a patch")
+	flags.BoolVar(&opt.Patch, "p", opt.Patch, "Alias of --patch")
+	flags.BoolVar(&opt.Patch, "u", opt.Patch, "Alias of --patch")
+
+	unified := flags.Int("unified", 3, "Generate <n> lines of context")
+	flags.IntVar(unified, "U", 3, "Alias of --unified")
+
+	flags.Var(&wordDiffValue{opt: opt}, "word-diff", "Show changed words within a line, instead of marking the whole line changed (plain, color, porcelain, or none)")
+
+	flags.BoolVar(&opt.IndentHeuristic, "indent-heuristic", true, "Slide hunk boundaries to make patches easier to read")
+	noIndentHeuristic := flags.Bool("no-indent-heuristic", false, "Disable the indent heuristic")
+
+	flags.Parse(args)
+
+	if *noIndentHeuristic {
+		opt.IndentHeuristic = false
+	}
+
+	opt.NumContextLines = *unified
+	if color {
+		opt.Color = isTerminal(os.Stdout)
+	}
+
+	return flags.Args(), nil
+}
+
+// printDiffs renders diffs to stdout according to opt: a short raw
+// listing of changed paths by default, or a full patch (optionally
+// with word-diff highlighting) when opt.Patch is set.
+func printDiffs(c *git.Client, opt git.DiffCommonOptions, diffs []git.HashDiff) error {
+	if !opt.Patch {
+		for _, d := range diffs {
+			fmt.Printf("%v\n", d)
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := git.GeneratePatch(c, opt, diffs, &buf); err != nil {
+		return err
+	}
+
+	patch := buf.String()
+	if opt.WordDiff != git.WordDiffNone {
+		patch = git.WordDiffHighlight(patch, opt)
+	}
+	fmt.Print(patch)
+	return nil
+}
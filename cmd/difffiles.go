@@ -3,8 +3,9 @@ package cmd
 import (
 	"flag"
 	"fmt"
+	"os"
 
-	"github.com/driusan/go-git/git"
+	"github.com/driusan/dgit/git"
 )
 
 func DiffFiles(c *git.Client, args []string) error {
@@ -22,9 +23,15 @@ func DiffFiles(c *git.Client, args []string) error {
 	//U := flags.Int("U", 3, "Alias of --unified")
 	flags.BoolVar(&options.Raw, "raw", true, "Generate the diff in raw format")
 	flags.BoolVar(&options.Recurse, "r", false, "Recurse into subtrees")
+	flags.Var(&wordDiffValue{opt: &options.DiffCommonOptions}, "word-diff", "Show changed words within a line, instead of marking the whole line changed (plain, color, porcelain, or none)")
+	flags.BoolVar(&options.IndentHeuristic, "indent-heuristic", true, "Slide hunk boundaries to make patches easier to read")
+	noIndentHeuristic := flags.Bool("no-indent-heuristic", false, "Disable the indent heuristic")
 
 	flags.Parse(args)
 	args = flags.Args()
+	if *noIndentHeuristic {
+		options.IndentHeuristic = false
+	}
 
 	if *patch || *p || *u {
 		options.Patch = true
@@ -43,10 +50,19 @@ func DiffFiles(c *git.Client, args []string) error {
 		} else {
 	*/
 	options.NumContextLines = 3
+	if options.WordDiff != git.WordDiffNone {
+		options.Color = isTerminal(os.Stdout)
+	}
 
 	diffs, err := git.DiffFiles(c, &options, args)
-	for _, diff := range diffs {
-		fmt.Printf("%v\n", diff)
+	if err != nil {
+		return err
+	}
+	if !options.Patch {
+		for _, diff := range diffs {
+			fmt.Printf("%v\n", diff)
+		}
+		return nil
 	}
-	return err
+	return printDiffs(c, options.DiffCommonOptions, diffs)
 }
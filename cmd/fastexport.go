@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"flag"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+// FastExport implements the "dgit fast-export" subcommand: it prints
+// a fast-import stream for the given refs (HEAD if none are given) to
+// stdout, suitable for piping into "dgit fast-import" or real git's.
+func FastExport(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("fast-export", flag.ExitOnError)
+	flags.SetOutput(flag.CommandLine.Output())
+
+	opt := git.FastExportOptions{}
+	flags.StringVar(&opt.ExportMarksFile, "export-marks", "", "Write the mark table to <file> after exporting")
+	flags.StringVar(&opt.ImportMarksFile, "import-marks", "", "Seed the mark table from <file> before exporting")
+
+	flags.Parse(args)
+	refArgs := flags.Args()
+	if len(refArgs) == 0 {
+		refArgs = []string{"HEAD"}
+	}
+
+	refs := make([]git.RefSpec, len(refArgs))
+	for i, r := range refArgs {
+		refs[i] = git.RefSpec(r)
+	}
+
+	return git.FastExport(c, os.Stdout, refs, opt)
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"flag"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+// FastImport implements the "dgit fast-import" subcommand: it reads a
+// fast-import stream from stdin and replays it into the repository,
+// writing objects and updating whatever refs the stream names.
+func FastImport(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("fast-import", flag.ExitOnError)
+	flags.SetOutput(flag.CommandLine.Output())
+
+	opt := git.FastImportOptions{}
+	flags.StringVar(&opt.ExportMarksFile, "export-marks", "", "Write the mark table to <file> after importing")
+	flags.StringVar(&opt.ImportMarksFile, "import-marks", "", "Seed the mark table from <file> before importing")
+
+	flags.Parse(args)
+
+	return git.FastImport(c, os.Stdin, opt)
+}
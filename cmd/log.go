@@ -45,27 +45,125 @@ func printCommit(c *git.Client, cmt git.CommitID) {
 
 var visited map[git.CommitID]bool
 
-func walkParents(c *git.Client, cmt git.CommitID) error {
+// followRenameThreshold is the default similarity, in the range
+// [0,1], that "log --follow" requires before it'll rewrite the
+// tracked path to an ancestor's name for it.
+const followRenameThreshold = 0.5
+
+// walkParents prints cmt and recurses into its parents in (reverse)
+// topological order. If paths is non-empty, only commits that touch
+// one of paths are printed. If follow is set, paths must contain
+// exactly one entry; when walkParents walks across the commit that
+// renamed it, it prints a notice above that commit and hands a copy of
+// paths holding the pre-rename name to that commit's parents, leaving
+// paths itself unchanged.
+func walkParents(c *git.Client, cmt git.CommitID, paths []git.File, follow bool) error {
 	if visited[cmt] {
 		return nil
 	}
 	visited[cmt] = true
-	printCommit(c, cmt)
+
 	parents, err := cmt.Parents(c)
 	if err != nil {
 		return err
 	}
+	var parent git.CommitID
+	if len(parents) > 0 {
+		parent = parents[0]
+	}
+
+	if len(paths) == 0 {
+		printCommit(c, cmt)
+	} else {
+		removed, added, err := git.ChangedPaths(c, cmt, parent, nil)
+		if err != nil {
+			return err
+		}
+		touched := commitTouches(cmt, parent, paths, removed, added)
+
+		if follow {
+			if rename, ok := followedRename(c, paths[0], removed, added); ok {
+				fmt.Printf("renamed from %v\n", rename.Src)
+				// paths is shared with every sibling branch still to
+				// be walked (eg. the other side of a merge), so the
+				// rename must only be reflected in the copy handed to
+				// this commit's own parents, not in paths itself.
+				renamed := make([]git.File, len(paths))
+				copy(renamed, paths)
+				renamed[0] = rename.Src
+				paths = renamed
+				touched = true
+			}
+		}
+		if touched {
+			printCommit(c, cmt)
+		}
+	}
+
 	for _, p := range parents {
-		if _, visited := visited[p]; visited {
+		if visited[p] {
 			continue
 		}
-		if err := walkParents(c, p); err != nil {
+		if err := walkParents(c, p, paths, follow); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// commitTouches reports whether any of paths differs between cmt and
+// parent, either because the blob at that path changed or because it
+// was added/removed outright.
+func commitTouches(cmt, parent git.CommitID, paths []git.File, removed, added []git.TreeEntry) bool {
+	for _, e := range removed {
+		if e.File.MatchesAny(paths) {
+			return true
+		}
+	}
+	for _, e := range added {
+		if e.File.MatchesAny(paths) {
+			return true
+		}
+	}
+	return false
+}
+
+// followedRename looks for path among the entries added by this
+// commit; if it's there, this is the commit that created path (quite
+// possibly by renaming it from something else), so it runs rename
+// detection between the removed and added blobs and returns the
+// rename pairing whose destination is path, if any was found above
+// followRenameThreshold.
+func followedRename(c *git.Client, path git.File, removed, added []git.TreeEntry) (git.Rename, bool) {
+	var wasAdded bool
+	for _, e := range added {
+		if e.File == path {
+			wasAdded = true
+			break
+		}
+	}
+	if !wasAdded {
+		return git.Rename{}, false
+	}
+	for _, e := range removed {
+		if e.File == path {
+			// path existed in the parent too, so it was modified here,
+			// not created.
+			return git.Rename{}, false
+		}
+	}
+	renames, err := git.RenameDetect(c, removed, added, followRenameThreshold)
+	if err != nil {
+		return git.Rename{}, false
+	}
+	for _, r := range renames {
+		if r.Dst == path {
+			return r, true
+		}
+	}
+	return git.Rename{}, false
+}
+
 func Log(c *git.Client, args []string) error {
 	flags := flag.NewFlagSet("log", flag.ExitOnError)
 	flags.SetOutput(flag.CommandLine.Output())
@@ -75,7 +173,8 @@ func Log(c *git.Client, args []string) error {
 		flags.PrintDefaults()
 	}
 
-	flags.Var(newNotimplBoolValue(), "follow", "Not implemented")
+	var follow bool
+	flags.BoolVar(&follow, "follow", false, "Continue listing history of a file beyond renames (single <path> only)")
 	flags.Var(newNotimplBoolValue(), "no-decorate", "Not implemented")
 	flags.Var(newNotimplStringValue(), "decorate", "Not implemented")
 	flags.Var(newNotimplStringValue(), "decorate-refs", "Not implemented")
@@ -88,8 +187,13 @@ func Log(c *git.Client, args []string) error {
 
 	flags.Parse(args)
 
-	if flags.NArg() > 1 {
-		fmt.Fprintf(flag.CommandLine.Output(), "Paths are not yet implemented, just the revision")
+	var paths []git.File
+	for _, p := range flags.Args()[min(flags.NArg(), 1):] {
+		paths = append(paths, git.File(p))
+	}
+
+	if follow && len(paths) != 1 {
+		fmt.Fprintf(flag.CommandLine.Output(), "--follow requires exactly one path")
 		flags.Usage()
 		os.Exit(2)
 	}
@@ -112,6 +216,12 @@ func Log(c *git.Client, args []string) error {
 
 	visited = make(map[git.CommitID]bool)
 
-	return walkParents(c, cmt)
+	return walkParents(c, cmt, paths, follow)
+}
 
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
 }
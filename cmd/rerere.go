@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/driusan/dgit/git"
+)
+
+// Rerere implements the "dgit rerere [status|diff|remaining|forget|clear|gc]"
+// subcommand: inspecting and managing the cache of recorded merge
+// conflict resolutions under .git/rr-cache. With no subcommand, it's
+// equivalent to "status".
+func Rerere(c *git.Client, args []string) error {
+	sub := "status"
+	if len(args) > 0 {
+		sub = args[0]
+		args = args[1:]
+	}
+
+	switch sub {
+	case "status", "remaining":
+		return rerereStatus(c, sub == "remaining")
+	case "diff":
+		return rerereDiff(c)
+	case "forget":
+		return rerereForget(c, args)
+	case "clear":
+		return rerereClear(c)
+	case "gc":
+		return rerereGC(c)
+	default:
+		return fmt.Errorf("rerere: unknown subcommand %q", sub)
+	}
+}
+
+// rerereStatus lists the paths with a currently-tracked conflict
+// resolution. When remainingOnly is set (the "remaining" spelling),
+// only paths that are still conflicted are listed.
+func rerereStatus(c *git.Client, remainingOnly bool) error {
+	rr, err := git.RerereTracked(c)
+	if err != nil {
+		return err
+	}
+	for path, resolved := range rr {
+		if remainingOnly && resolved {
+			continue
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
+
+// rerereDiff shows, for each tracked path, the recorded preimage and
+// its current (possibly still conflicted) contents, as RerereDiff
+// renders them.
+func rerereDiff(c *git.Client) error {
+	diffs, err := git.RerereDiff(c)
+	if err != nil {
+		return err
+	}
+	for _, d := range diffs {
+		fmt.Print(d)
+	}
+	return nil
+}
+
+// rerereForget drops the rr-cache entries for the given paths (or, if
+// none are given, every currently-tracked path) so they'll be
+// recorded afresh next time they conflict.
+func rerereForget(c *git.Client, paths []string) error {
+	files := make([]git.File, len(paths))
+	for i, p := range paths {
+		files[i] = git.File(p)
+	}
+	return git.RerereForget(c, files)
+}
+
+// rerereClear removes every rr-cache entry, whatever its age.
+func rerereClear(c *git.Client) error {
+	return git.RerereGC(c, 0)
+}
+
+// rerereGC prunes rr-cache entries whose preimage hasn't been written
+// in the last 15 days. The window is fixed: no config setting is read,
+// and resolved and unresolved entries are treated alike.
+func rerereGC(c *git.Client) error {
+	return git.RerereGC(c, 15)
+}
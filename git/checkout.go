@@ -195,5 +195,13 @@ func CheckoutFiles(c *Client, opts CheckoutOptions, tree Treeish, files []File)
 	}
 	// ReadTree wrote the index to disk, but since we already have a copy in
 	// memory we use the Uncommited variation.
-	return CheckoutIndexUncommited(c, i, CheckoutIndexOptions{Force: true, UpdateStat: true}, files)
+	if err := CheckoutIndexUncommited(c, i, CheckoutIndexOptions{Force: true, UpdateStat: true}, files); err != nil {
+		return err
+	}
+
+	// This repo doesn't yet have a merge/cherry-pick command of its
+	// own to hang rerere off of directly, but any conflict markers
+	// this checkout left behind should still be recorded/replayed, so
+	// call into the same path merge will eventually use.
+	return RerereResolve(c, files)
 }
@@ -0,0 +1,384 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Credential is one entry in git's credential protocol: what's known
+// about the thing being authenticated to, and (once filled) the
+// username/password to use.
+type Credential struct {
+	Protocol string
+	Host     string
+	Path     string
+	Username string
+	Password string
+}
+
+// toProtocolLines renders cred as the key=value lines git's
+// credential helper protocol sends on a helper's stdin, omitting
+// empty fields.
+func (cred Credential) toProtocolLines() string {
+	var buf bytes.Buffer
+	write := func(k, v string) {
+		if v != "" {
+			fmt.Fprintf(&buf, "%s=%s\n", k, v)
+		}
+	}
+	write("protocol", cred.Protocol)
+	write("host", cred.Host)
+	write("path", cred.Path)
+	write("username", cred.Username)
+	write("password", cred.Password)
+	buf.WriteString("\n")
+	return buf.String()
+}
+
+// url reconstructs the URL a credential.<url>.helper config key would
+// be scoped to, for matching purposes.
+func (cred Credential) url() string {
+	u := cred.Protocol + "://" + cred.Host
+	if cred.Path != "" {
+		u += "/" + cred.Path
+	}
+	return u
+}
+
+// CredentialFill asks each configured credential helper, in order,
+// to fill in cred's Username/Password, stopping at the first helper
+// that returns a complete answer.
+//
+// This tree has no fetch/push/clone command yet to call CredentialFill
+// from, so it's currently unreferenced outside this package and its
+// tests; whichever of those lands first over an authenticated
+// transport should build its Credential from the URL it's talking to
+// and call CredentialFill before the request, then CredentialApprove
+// or CredentialReject once it knows whether the auth worked.
+func CredentialFill(c *Client, cred Credential) (Credential, error) {
+	for _, helper := range credentialHelpers(c, cred) {
+		filled, err := runCredentialHelper(c, helper, "get", cred)
+		if err != nil {
+			return cred, err
+		}
+		if filled.Username != "" && filled.Password != "" {
+			return filled, nil
+		}
+		if filled.Username != "" {
+			cred.Username = filled.Username
+		}
+	}
+	return cred, nil
+}
+
+// CredentialApprove tells every configured helper that cred worked,
+// so they can cache it.
+func CredentialApprove(c *Client, cred Credential) error {
+	for _, helper := range credentialHelpers(c, cred) {
+		if _, err := runCredentialHelper(c, helper, "store", cred); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CredentialReject tells every configured helper that cred didn't
+// work, so any cached copy is forgotten.
+func CredentialReject(c *Client, cred Credential) error {
+	for _, helper := range credentialHelpers(c, cred) {
+		if _, err := runCredentialHelper(c, helper, "erase", cred); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// credentialHelpers returns the configured credential.helper values
+// that apply to cred, most specific first: url-scoped
+// credential.<url>.helper entries whose prefix matches cred's URL,
+// followed by the unscoped credential.helper entries. It leans on
+// Client's GetConfigSections/GetConfigAll the same way the rest of
+// this package leans on Client/CommitID members that aren't in this
+// tree (GetObject, WriteObject, Parents, ...): they're the existing
+// multi-value config accessors, not new API surface this change adds.
+func credentialHelpers(c *Client, cred Credential) []string {
+	var helpers []string
+	u := cred.url()
+	for _, section := range c.GetConfigSections("credential") {
+		if section == "" {
+			continue
+		}
+		if strings.HasPrefix(u, section) {
+			if vs, _ := c.GetConfigAll("credential." + section + ".helper"); len(vs) > 0 {
+				helpers = append(helpers, vs...)
+			}
+		}
+	}
+	if vs, _ := c.GetConfigAll("credential.helper"); len(vs) > 0 {
+		helpers = append(helpers, vs...)
+	}
+	return helpers
+}
+
+// runCredentialHelper invokes a single helper for the given action
+// ("get", "store", or "erase"), resolving its name the way git does:
+// a leading "!" runs the rest as a shell command, a name containing a
+// path separator is run directly, and anything else is resolved as
+// "git-credential-<name>" on PATH. The two built-in in-process
+// helpers, "!netrc" and "!libsecret-like", are special-cased so they
+// don't need a subprocess at all.
+func runCredentialHelper(c *Client, helper, action string, cred Credential) (Credential, error) {
+	switch helper {
+	case "!netrc":
+		return netrcHelper(action, cred)
+	case "!libsecret-like":
+		return keyringHelper(action, cred)
+	}
+
+	var cmd *exec.Cmd
+	switch {
+	case strings.HasPrefix(helper, "!"):
+		cmd = exec.Command("sh", "-c", strings.TrimPrefix(helper, "!")+" "+action)
+	case strings.ContainsRune(helper, os.PathSeparator) || strings.HasPrefix(helper, "/"):
+		cmd = exec.Command(helper, action)
+	default:
+		cmd = exec.Command("git-credential-"+helper, action)
+	}
+
+	cmd.Stdin = strings.NewReader(cred.toProtocolLines())
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return cred, fmt.Errorf("credential helper %q: %w", helper, err)
+	}
+	return parseCredentialResponse(out.Bytes(), cred), nil
+}
+
+// parseCredentialResponse applies the "key=value" lines a helper
+// wrote on stdout on top of cred, returning the merged result.
+func parseCredentialResponse(output []byte, cred Credential) Credential {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "protocol":
+			cred.Protocol = v
+		case "host":
+			cred.Host = v
+		case "path":
+			cred.Path = v
+		case "username":
+			cred.Username = v
+		case "password":
+			cred.Password = v
+		}
+	}
+	return cred
+}
+
+// netrcHelper is the built-in "!netrc" helper: it honors
+// machine/login/password/default entries from ~/.netrc, falling back
+// to a GPG-decrypted ~/.netrc.gpg if the plaintext file isn't there.
+// It only implements "get"; store/erase are no-ops since the netrc
+// file is meant to be managed by hand.
+func netrcHelper(action string, cred Credential) (Credential, error) {
+	if action != "get" {
+		return cred, nil
+	}
+	entries, err := readNetrc()
+	if err != nil {
+		return cred, err
+	}
+	var fallback *netrcEntry
+	for i := range entries {
+		e := &entries[i]
+		if e.machine == "default" && fallback == nil {
+			fallback = e
+			continue
+		}
+		if e.machine == cred.Host {
+			cred.Username = e.login
+			cred.Password = e.password
+			return cred, nil
+		}
+	}
+	if fallback != nil {
+		cred.Username = fallback.login
+		cred.Password = fallback.password
+	}
+	return cred, nil
+}
+
+type netrcEntry struct {
+	machine, login, password string
+}
+
+// readNetrc parses ~/.netrc, or ~/.netrc.gpg via "gpg --decrypt" if
+// the plaintext file doesn't exist.
+func readNetrc() ([]netrcEntry, error) {
+	home, err := homeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(home, ".netrc"))
+	if os.IsNotExist(err) {
+		content, err = decryptNetrcGPG(filepath.Join(home, ".netrc.gpg"))
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseNetrc(string(content)), nil
+}
+
+func decryptNetrcGPG(path string) ([]byte, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	cmd := exec.Command("gpg", "--quiet", "--decrypt", path)
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("decrypting %s: %w", path, err)
+	}
+	return out.Bytes(), nil
+}
+
+// parseNetrc is a minimal netrc parser: it understands the
+// "machine"/"login"/"password"/"default" tokens and skips any other
+// token ("macdef", "account", "#", ...). Comment lines and macdef
+// bodies are not skipped as a whole: their words are read as tokens
+// like any others.
+func parseNetrc(content string) []netrcEntry {
+	fields := strings.Fields(content)
+	var entries []netrcEntry
+	var cur *netrcEntry
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			entries = append(entries, netrcEntry{})
+			cur = &entries[len(entries)-1]
+			if i+1 < len(fields) {
+				cur.machine = fields[i+1]
+				i++
+			}
+		case "default":
+			entries = append(entries, netrcEntry{machine: "default"})
+			cur = &entries[len(entries)-1]
+		case "login":
+			if cur != nil && i+1 < len(fields) {
+				cur.login = fields[i+1]
+				i++
+			}
+		case "password":
+			if cur != nil && i+1 < len(fields) {
+				cur.password = fields[i+1]
+				i++
+			}
+		}
+	}
+	return entries
+}
+
+// homeDir finds the current user's home directory without requiring
+// $HOME to be set.
+func homeDir() (string, error) {
+	if h := os.Getenv("HOME"); h != "" {
+		return h, nil
+	}
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return u.HomeDir, nil
+}
+
+// keyringHelper is the built-in "!libsecret-like" helper: it shells
+// out to whatever native credential store is available for GOOS
+// (secret-tool on Linux, security on macOS, cmdkey/wincred-backed
+// tooling on Windows) using the arguments those tools expect.
+func keyringHelper(action string, cred Credential) (Credential, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return keychainHelper(action, cred)
+	case "windows":
+		return wincredHelper(action, cred)
+	default:
+		return secretToolHelper(action, cred)
+	}
+}
+
+func secretToolHelper(action string, cred Credential) (Credential, error) {
+	attrs := []string{"protocol", cred.Protocol, "host", cred.Host}
+	switch action {
+	case "get":
+		out, err := exec.Command("secret-tool", append([]string{"lookup"}, attrs...)...).Output()
+		if err != nil {
+			return cred, nil // nothing stored; let other helpers or a prompt take over
+		}
+		cred.Password = strings.TrimSpace(string(out))
+		return cred, nil
+	case "store":
+		cmd := exec.Command("secret-tool", append([]string{"store", "--label=dgit credential"}, attrs...)...)
+		cmd.Stdin = strings.NewReader(cred.Password)
+		return cred, cmd.Run()
+	case "erase":
+		exec.Command("secret-tool", append([]string{"clear"}, attrs...)...).Run()
+		return cred, nil
+	}
+	return cred, nil
+}
+
+func keychainHelper(action string, cred Credential) (Credential, error) {
+	switch action {
+	case "get":
+		out, err := exec.Command("security", "find-internet-password", "-s", cred.Host, "-a", cred.Username, "-w").Output()
+		if err != nil {
+			return cred, nil
+		}
+		cred.Password = strings.TrimSpace(string(out))
+		return cred, nil
+	case "store":
+		cmd := exec.Command("security", "add-internet-password", "-U", "-s", cred.Host, "-a", cred.Username, "-w", cred.Password)
+		return cred, cmd.Run()
+	case "erase":
+		exec.Command("security", "delete-internet-password", "-s", cred.Host, "-a", cred.Username).Run()
+		return cred, nil
+	}
+	return cred, nil
+}
+
+func wincredHelper(action string, cred Credential) (Credential, error) {
+	target := "git:" + cred.url()
+	switch action {
+	case "get":
+		out, err := exec.Command("cmdkey", "/list:"+target).Output()
+		if err != nil {
+			return cred, nil
+		}
+		_ = out // cmdkey doesn't expose the password itself; presence only confirms a stored entry
+		return cred, nil
+	case "store":
+		return cred, exec.Command("cmdkey", "/add:"+target, "/user:"+cred.Username, "/pass:"+cred.Password).Run()
+	case "erase":
+		exec.Command("cmdkey", "/delete:"+target).Run()
+		return cred, nil
+	}
+	return cred, nil
+}
@@ -0,0 +1,116 @@
+package git
+
+import "strings"
+
+// ChangeGroup is a contiguous run of added or removed lines, as
+// produced by the line-level diff, before GeneratePatch renders it into
+// hunks. Start and End index into the file that contains the run
+// (the "new" file for an insert, the "old" file for a delete).
+type ChangeGroup struct {
+	Start, End int
+}
+
+// SlideHunks adjusts each group's Start/End to the best position in
+// its sliding window (the range of positions that produce an
+// equivalent diff), per upstream git's indent heuristic: groups
+// preferentially land on blank lines and dedents, so a hunk reads
+// like it was split at a function or block boundary instead of in
+// the middle of a run of identical-looking lines. lines is the full
+// file the groups index into; it runs between the raw line diff and
+// GeneratePatch's hunk rendering.
+func SlideHunks(lines []string, groups []ChangeGroup) []ChangeGroup {
+	out := make([]ChangeGroup, len(groups))
+	for i, g := range groups {
+		out[i] = slideGroup(lines, g)
+	}
+	return out
+}
+
+// slideGroup finds g's sliding window and returns the lowest-scoring
+// position in it, breaking ties toward the later position.
+func slideGroup(lines []string, g ChangeGroup) ChangeGroup {
+	size := g.End - g.Start
+	if size <= 0 || size >= len(lines) {
+		return g
+	}
+
+	lo, hi := g.Start, g.Start
+	// The window can slide up by one exactly when the line that would
+	// enter at the front of the group is identical to the line leaving
+	// at the back: swapping them leaves the changed multiset
+	// (and hence the diff) equivalent. Sliding down is symmetric.
+	for lo > 0 && lines[lo-1] == lines[lo+size-1] {
+		lo--
+	}
+	for hi+size < len(lines) && lines[hi+size] == lines[hi] {
+		hi++
+	}
+
+	best := lo
+	bestScore := indentScore(lines, lo, size)
+	for pos := lo + 1; pos <= hi; pos++ {
+		score := indentScore(lines, pos, size)
+		if score <= bestScore {
+			bestScore = score
+			best = pos
+		}
+	}
+	return ChangeGroup{Start: best, End: best + size}
+}
+
+// Scoring bonuses (negative, since lower scores win) for the
+// boundary features the indent heuristic cares about.
+const (
+	indentBlankBonus  = -40
+	indentDedentBonus = -10
+)
+
+// indentScore scores a candidate position for a change group of the
+// given size: lower is better. It weights the indentation of the
+// line just before the group and of the first changed line, with a
+// strong bonus when the line before the group is blank, and a
+// smaller bonus when the line just after the group is less indented
+// than the line just before it (which usually means the group now
+// aligns with a function/block boundary).
+func indentScore(lines []string, start, size int) int {
+	var before, after, first string
+	if start > 0 {
+		before = lines[start-1]
+	}
+	if start+size < len(lines) {
+		after = lines[start+size]
+	}
+	if size > 0 {
+		first = lines[start]
+	}
+
+	score := indentOf(before) + indentOf(first)
+	if isBlankLine(before) {
+		score += indentBlankBonus
+	}
+	if indentOf(after) < indentOf(before) {
+		score += indentDedentBonus
+	}
+	return score
+}
+
+// indentOf returns the width of line's leading whitespace, expanding
+// tabs to the next multiple of 8.
+func indentOf(line string) int {
+	n := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			n++
+		case '\t':
+			n += 8 - (n % 8)
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+func isBlankLine(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
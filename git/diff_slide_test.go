@@ -0,0 +1,33 @@
+package git
+
+import "testing"
+
+// TestSlideHunksPrefersBlankLine checks the canonical indent-heuristic
+// case: an inserted line that could equally be placed anywhere in a
+// run of blank lines slides to sit right after the blank line rather
+// than at its raw line-diff position.
+func TestSlideHunksPrefersBlankLine(t *testing.T) {
+	lines := []string{
+		"func f() {",
+		"",
+		"",
+		"	return 1",
+		"}",
+	}
+	// A line diff has no preference among the raw positions in
+	// [1,3) for an insertion that slides within the blank-line run;
+	// it's equally valid for the inserted line to start at index 1
+	// or 2. Start it at the earliest of those raw positions.
+	raw := []ChangeGroup{{Start: 1, End: 2}}
+
+	slid := SlideHunks(lines, raw)
+	if len(slid) != 1 {
+		t.Fatalf("len(slid) = %d, want 1", len(slid))
+	}
+	if slid[0] == raw[0] {
+		t.Fatalf("SlideHunks left the group at its raw position %v; indent heuristic had nothing to do", raw[0])
+	}
+	if got, want := slid[0], (ChangeGroup{Start: 2, End: 3}); got != want {
+		t.Errorf("SlideHunks(%v) = %v, want %v (slid past the blank line)", raw[0], got, want)
+	}
+}
@@ -0,0 +1,53 @@
+package git
+
+// WordDiffMode is the --word-diff[=<mode>] setting for the diff
+// family of commands.
+type WordDiffMode string
+
+const (
+	// WordDiffNone disables intra-line highlighting; changed lines
+	// are rendered the usual whole-line way.
+	WordDiffNone WordDiffMode = ""
+	// WordDiffPlain wraps changed word runs in [-old-]/{+new+}
+	// markers, with no color.
+	WordDiffPlain WordDiffMode = "plain"
+	// WordDiffColor wraps changed word runs in ANSI color, falling
+	// back to WordDiffPlain's markers when stdout isn't a terminal.
+	WordDiffColor WordDiffMode = "color"
+	// WordDiffPorcelain uses WordDiffPlain's markers, but renders each
+	// removed/added pair as one combined line instead of two, for
+	// machine consumption rather than a human reading a terminal.
+	WordDiffPorcelain WordDiffMode = "porcelain"
+)
+
+// DiffCommonOptions holds the options common to all the diff-family
+// subcommands (diff, diff-files, diff-index, diff-tree): whether to
+// render a patch at all, how much context to include, and how to
+// color/annotate it.
+type DiffCommonOptions struct {
+	// Patch generates a patch, instead of just a raw list of changed
+	// paths.
+	Patch bool
+
+	// NumContextLines is the number of context lines to include
+	// around each hunk.
+	NumContextLines int
+
+	// Color forces color on for patch output. Commands derive this
+	// from whether stdout is a terminal unless overridden.
+	Color bool
+
+	// SrcPrefix and DstPrefix are the a/ and b/ style prefixes used
+	// in front of paths in a patch.
+	SrcPrefix, DstPrefix string
+
+	// WordDiff controls intra-line highlighting of patch output.
+	// The zero value, WordDiffNone, means the usual line-level diff.
+	WordDiff WordDiffMode
+
+	// IndentHeuristic slides each change group to the best position
+	// in its sliding window (see SlideHunks) before rendering it,
+	// instead of leaving it at the raw line-diff position. Defaults
+	// to on, matching modern git.
+	IndentHeuristic bool
+}
@@ -0,0 +1,581 @@
+package git
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FastExportOptions controls FastExport.
+type FastExportOptions struct {
+	// ExportMarksFile, if set, is where the mark table is written
+	// after export, for a later incremental export to pick up via
+	// ImportMarksFile.
+	ExportMarksFile string
+	// ImportMarksFile, if set, seeds the mark table so objects
+	// exported by a previous run aren't re-emitted.
+	ImportMarksFile string
+}
+
+// FastImportOptions controls FastImport. The mark file fields mean
+// the same thing as FastExportOptions's, just from the consuming
+// side: ImportMarksFile seeds the table from a previous export or
+// import, and ExportMarksFile is where this run's table is saved.
+type FastImportOptions struct {
+	ExportMarksFile string
+	ImportMarksFile string
+}
+
+// markTable is the :N <-> sha1 table shared by FastExport and
+// FastImport, persisted via --export-marks/--import-marks so an
+// incremental run doesn't have to redo earlier ones.
+type markTable struct {
+	next   int
+	toMark map[string]int
+	toSha1 map[int]string
+}
+
+func newMarkTable() *markTable {
+	return &markTable{next: 1, toMark: map[string]int{}, toSha1: map[int]string{}}
+}
+
+func (m *markTable) markOf(sha1 string) (int, bool) {
+	n, ok := m.toMark[sha1]
+	return n, ok
+}
+
+func (m *markTable) assign(sha1 string) int {
+	if n, ok := m.toMark[sha1]; ok {
+		return n
+	}
+	n := m.next
+	m.next++
+	m.toMark[sha1] = n
+	m.toSha1[n] = sha1
+	return n
+}
+
+func (m *markTable) record(sha1 string, mark int) {
+	m.toMark[sha1] = mark
+	m.toSha1[mark] = sha1
+	if mark >= m.next {
+		m.next = mark + 1
+	}
+}
+
+func loadMarks(path string) (*markTable, error) {
+	m := newMarkTable()
+	if path == "" {
+		return m, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" {
+			continue
+		}
+		var mark int
+		var sha1 string
+		if _, err := fmt.Sscanf(line, ":%d %s", &mark, &sha1); err != nil {
+			continue
+		}
+		m.record(sha1, mark)
+	}
+	return m, nil
+}
+
+func (m *markTable) save(path string) error {
+	if path == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	for mark := 1; mark < m.next; mark++ {
+		if sha1, ok := m.toSha1[mark]; ok {
+			fmt.Fprintf(&buf, ":%d %s\n", mark, sha1)
+		}
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// FastExport walks history reachable from each of refs (generalizing
+// the traversal cmd/log.go's walkParents does for a single branch,
+// via WalkCommitsTopo) and writes it to w as a fast-import stream:
+// one "blob" record per blob it hasn't already exported, one "commit"
+// record per commit whose M/D file-change lines reference those
+// blobs by mark, and a final "reset" pointing the ref at the tip
+// commit's mark.
+func FastExport(c *Client, w io.Writer, refs []RefSpec, opt FastExportOptions) error {
+	marks, err := loadMarks(opt.ImportMarksFile)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		commit, err := RevParseCommitish(c, &RevParseOptions{}, string(ref))
+		if err != nil {
+			return err
+		}
+		tip, err := commit.CommitID(c)
+		if err != nil {
+			return err
+		}
+
+		order, err := WalkCommitsTopo(c, tip)
+		if err != nil {
+			return err
+		}
+		for _, cmt := range order {
+			if _, ok := marks.markOf(cmt.String()); ok {
+				continue // already exported by an earlier incremental run
+			}
+			if err := exportCommit(c, w, marks, string(ref), cmt); err != nil {
+				return err
+			}
+		}
+
+		tipMark, _ := marks.markOf(tip.String())
+		fmt.Fprintf(w, "reset %s\nfrom :%d\n\n", ref, tipMark)
+	}
+
+	return marks.save(opt.ExportMarksFile)
+}
+
+// exportCommit writes one commit's blob and commit records to w. ref
+// is the fast-import ref name this commit is being exported as part
+// of (eg. "refs/heads/master"), which every commit record in the
+// stream must carry even though WalkCommitsTopo itself only deals in
+// CommitIDs.
+func exportCommit(c *Client, w io.Writer, marks *markTable, ref string, cmt CommitID) error {
+	parents, err := cmt.Parents(c)
+	if err != nil {
+		return err
+	}
+	var parent CommitID
+	if len(parents) > 0 {
+		parent = parents[0]
+	}
+
+	removed, added, err := ChangedPaths(c, cmt, parent, nil)
+	if err != nil {
+		return err
+	}
+
+	// Every blob this commit introduces gets its own mark, which the
+	// M lines below reference instead of inlining content: that way
+	// an incremental re-export recognizes a blob it's already
+	// written, and FastImport (which only understands M lines of the
+	// form "M <mode> :<mark> <path>") can read the stream back.
+	for _, e := range added {
+		if _, ok := marks.markOf(string(e.Sha1)); ok {
+			continue
+		}
+		_, content, err := c.GetObject(e.Sha1)
+		if err != nil {
+			return err
+		}
+		mark := marks.assign(string(e.Sha1))
+		fmt.Fprintf(w, "blob\nmark :%d\ndata %d\n%s\n", mark, len(content), content)
+	}
+
+	author, err := cmt.GetAuthor(c)
+	if err != nil {
+		return err
+	}
+	authorDate, err := cmt.GetDate(c)
+	if err != nil {
+		return err
+	}
+	committer, err := cmt.GetCommitter(c)
+	if err != nil {
+		return err
+	}
+	committerDate, err := cmt.GetCommitterDate(c)
+	if err != nil {
+		return err
+	}
+	msg, err := cmt.GetCommitMessage(c)
+	if err != nil {
+		return err
+	}
+	body := msg.String()
+
+	mark := marks.assign(cmt.String())
+	fmt.Fprintf(w, "commit %s\nmark :%d\n", ref, mark)
+	fmt.Fprintf(w, "author %s\ncommitter %s\n", identLine(author, authorDate), identLine(committer, committerDate))
+	fmt.Fprintf(w, "data %d\n%s\n", len(body), body)
+
+	if len(parents) > 0 {
+		if pm, ok := marks.markOf(parents[0].String()); ok {
+			fmt.Fprintf(w, "from :%d\n", pm)
+		}
+		for _, p := range parents[1:] {
+			if pm, ok := marks.markOf(p.String()); ok {
+				fmt.Fprintf(w, "merge :%d\n", pm)
+			}
+		}
+	}
+
+	for _, e := range added {
+		blobMark, ok := marks.markOf(string(e.Sha1))
+		if !ok {
+			return fmt.Errorf("fast-export: %s has no mark despite being exported just above", e.File)
+		}
+		fmt.Fprintf(w, "M %s :%d %s\n", e.Mode, blobMark, e.File)
+	}
+	for _, e := range removed {
+		if _, ok := addedPath(added, e.File); ok {
+			continue // modified, not deleted; already covered by the M line above
+		}
+		fmt.Fprintf(w, "D %s\n", e.File)
+	}
+	fmt.Fprintln(w)
+	return nil
+}
+
+// identLine formats who (eg. "Name <email>") and when as a raw
+// commit object's author/committer line actually stores them: the
+// name and email followed by "<unixtime> <tz>", not just the name and
+// email GetAuthor/GetCommitter return on their own.
+func identLine(who string, when time.Time) string {
+	return fmt.Sprintf("%s %d %s", who, when.Unix(), when.Format("-0700"))
+}
+
+func addedPath(added []TreeEntry, f File) (TreeEntry, bool) {
+	for _, e := range added {
+		if e.File == f {
+			return e, true
+		}
+	}
+	return TreeEntry{}, false
+}
+
+// fastImportCommit is the incrementally-built path -> blob map for one
+// commit in progress during FastImport, along with the state needed
+// to assemble and write the actual tree/commit objects once the
+// commit record is complete.
+type fastImportCommit struct {
+	mark      int
+	author    string
+	committer string
+	message   []byte
+	parents   []int
+	tree      map[File]fastImportEntry
+}
+
+// fastImportEntry is one path's current state in a fastImportCommit's
+// tree: the blob an "M" line pointed it at and the mode that same
+// line carried, so an executable or symlink blob keeps its mode
+// through the round trip instead of being flattened to a plain file.
+type fastImportEntry struct {
+	Sha1 Sha1
+	Mode string
+}
+
+// FastImport consumes a fast-import stream (as produced by FastExport
+// or real git fast-export) and replays it into c's object store: each
+// blob is written via WriteObject, each commit's tree is assembled
+// from the running M/D file-change state inherited from its "from"
+// parent, and refs named by "reset"/"commit" records are updated once
+// the whole stream has been consumed.
+//
+// Renames/copies ("R"/"C" commands) and annotated tag objects aren't
+// modelled by this tree yet; a stream containing them is rejected
+// with an error naming the unsupported command instead of silently
+// mis-importing it.
+func FastImport(c *Client, r io.Reader, opt FastImportOptions) error {
+	marks, err := loadMarks(opt.ImportMarksFile)
+	if err != nil {
+		return err
+	}
+
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(raw), "\n")
+
+	trees := map[int]map[File]fastImportEntry{}
+	refs := map[string]int{}
+
+	i := 0
+	next := func() string {
+		if i >= len(lines) {
+			return ""
+		}
+		l := lines[i]
+		i++
+		return l
+	}
+	readData := func(header string) ([]byte, error) {
+		n, err := parseDataLen(header)
+		if err != nil {
+			return nil, err
+		}
+		// lines was split on "\n", so reassemble exactly n bytes of
+		// payload (which may itself contain embedded newlines) from
+		// however many of the split lines that spans.
+		var buf bytes.Buffer
+		for buf.Len() < n {
+			if buf.Len() > 0 {
+				buf.WriteByte('\n')
+			}
+			buf.WriteString(next())
+		}
+		return buf.Bytes()[:n], nil
+	}
+
+	// isCommitBodyLine reports whether line continues the commit
+	// record currently being parsed (as opposed to starting the next
+	// top-level record).
+	isCommitBodyLine := func(line string) bool {
+		switch {
+		case strings.HasPrefix(line, "mark :"),
+			strings.HasPrefix(line, "author "),
+			strings.HasPrefix(line, "committer "),
+			strings.HasPrefix(line, "data "),
+			strings.HasPrefix(line, "from :"),
+			strings.HasPrefix(line, "merge :"),
+			strings.HasPrefix(line, "M "),
+			strings.HasPrefix(line, "D "):
+			return true
+		default:
+			return false
+		}
+	}
+
+	for i < len(lines) {
+		line := next()
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "blob"):
+			var mark int
+			fmt.Sscanf(next(), "mark :%d", &mark)
+			content, err := readData(next())
+			if err != nil {
+				return err
+			}
+			sha1, err := WriteObject(c, "blob", content)
+			if err != nil {
+				return err
+			}
+			marks.record(string(sha1), mark)
+
+		case strings.HasPrefix(line, "reset "):
+			refname := strings.TrimPrefix(line, "reset ")
+			if strings.HasPrefix(peek(lines, i), "from :") {
+				var m int
+				fmt.Sscanf(next(), "from :%d", &m)
+				refs[refname] = m
+			}
+
+		case strings.HasPrefix(line, "commit "):
+			refname := strings.TrimPrefix(line, "commit ")
+			cc := &fastImportCommit{tree: map[File]fastImportEntry{}}
+
+			for i < len(lines) && (peek(lines, i) == "" || isCommitBodyLine(peek(lines, i))) {
+				cline := next()
+				switch {
+				case cline == "":
+					continue
+				case strings.HasPrefix(cline, "mark :"):
+					fmt.Sscanf(cline, "mark :%d", &cc.mark)
+				case strings.HasPrefix(cline, "author "):
+					cc.author = strings.TrimPrefix(cline, "author ")
+				case strings.HasPrefix(cline, "committer "):
+					cc.committer = strings.TrimPrefix(cline, "committer ")
+				case strings.HasPrefix(cline, "data "):
+					data, err := readData(cline)
+					if err != nil {
+						return err
+					}
+					cc.message = data
+				case strings.HasPrefix(cline, "from :"):
+					var pm int
+					fmt.Sscanf(cline, "from :%d", &pm)
+					cc.parents = append([]int{pm}, cc.parents...)
+					if parentTree, ok := trees[pm]; ok {
+						for f, s := range parentTree {
+							cc.tree[f] = s
+						}
+					}
+				case strings.HasPrefix(cline, "merge :"):
+					var pm int
+					fmt.Sscanf(cline, "merge :%d", &pm)
+					cc.parents = append(cc.parents, pm)
+				case strings.HasPrefix(cline, "M "):
+					fields := strings.SplitN(cline, " ", 4)
+					if len(fields) != 4 {
+						return fmt.Errorf("fast-import: malformed M line %q", cline)
+					}
+					markRef, path := fields[2], fields[3]
+					if markRef == "inline" {
+						return fmt.Errorf("fast-import: inline M file content isn't supported, only mark references")
+					}
+					if !strings.HasPrefix(markRef, ":") {
+						return fmt.Errorf("fast-import: unsupported M file content %q", markRef)
+					}
+					var bm int
+					fmt.Sscanf(markRef, ":%d", &bm)
+					sha1, ok := marks.toSha1[bm]
+					if !ok {
+						return fmt.Errorf("fast-import: M line references unknown mark :%d", bm)
+					}
+					cc.tree[File(path)] = fastImportEntry{Sha1: Sha1(sha1), Mode: fields[1]}
+				case strings.HasPrefix(cline, "D "):
+					delete(cc.tree, File(strings.TrimPrefix(cline, "D ")))
+				}
+			}
+
+			treeSha1, err := writeTreeFromPaths(c, cc.tree)
+			if err != nil {
+				return err
+			}
+			var parentSha1s []Sha1
+			for _, pm := range cc.parents {
+				if sha1, ok := marks.toSha1[pm]; ok {
+					parentSha1s = append(parentSha1s, Sha1(sha1))
+				}
+			}
+			if cc.committer == "" {
+				cc.committer = cc.author
+			}
+			commitSha1, err := writeCommitObject(c, treeSha1, parentSha1s, cc.author, cc.committer, cc.message)
+			if err != nil {
+				return err
+			}
+
+			trees[cc.mark] = cc.tree
+			marks.record(string(commitSha1), cc.mark)
+			refs[refname] = cc.mark
+
+		case strings.HasPrefix(line, "tag "), strings.HasPrefix(line, "R "), strings.HasPrefix(line, "C "):
+			return fmt.Errorf("fast-import: %q isn't supported yet", strings.Fields(line)[0])
+		}
+	}
+
+	for refname, mark := range refs {
+		sha1, ok := marks.toSha1[mark]
+		if !ok {
+			continue
+		}
+		if err := UpdateRef(c, UpdateRefOptions{}, RefSpec(refname), CommitID(sha1), "fast-import"); err != nil {
+			return err
+		}
+	}
+
+	return marks.save(opt.ExportMarksFile)
+}
+
+func peek(lines []string, i int) string {
+	if i >= len(lines) {
+		return ""
+	}
+	return lines[i]
+}
+
+func parseDataLen(header string) (int, error) {
+	fields := strings.Fields(header)
+	if len(fields) != 2 || fields[0] != "data" {
+		return 0, fmt.Errorf("fast-import: malformed data header %q", header)
+	}
+	return strconv.Atoi(fields[1])
+}
+
+// writeTreeFromPaths builds the (possibly nested) tree objects for a
+// flat path -> blob map and returns the root tree's Sha1. Each blob
+// keeps the mode its own "M" line carried, so an executable or
+// symlink entry comes back out as "100755"/"120000" rather than being
+// flattened to a plain file.
+func writeTreeFromPaths(c *Client, paths map[File]fastImportEntry) (Sha1, error) {
+	type node struct {
+		blob     Sha1
+		mode     string
+		isBlob   bool
+		children map[string]*node
+	}
+	root := &node{children: map[string]*node{}}
+	for path, entry := range paths {
+		parts := strings.Split(string(path), "/")
+		cur := root
+		for i, part := range parts {
+			if i == len(parts)-1 {
+				cur.children[part] = &node{blob: entry.Sha1, mode: entry.Mode, isBlob: true}
+				continue
+			}
+			next, ok := cur.children[part]
+			if !ok {
+				next = &node{children: map[string]*node{}}
+				cur.children[part] = next
+			}
+			cur = next
+		}
+	}
+
+	var writeNode func(*node) (Sha1, error)
+	writeNode = func(n *node) (Sha1, error) {
+		var names []string
+		for name := range n.children {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var buf bytes.Buffer
+		for _, name := range names {
+			child := n.children[name]
+			if child.isBlob {
+				raw, err := sha1Bytes(child.blob)
+				if err != nil {
+					return "", err
+				}
+				fmt.Fprintf(&buf, "%s %s\x00", child.mode, name)
+				buf.Write(raw)
+				continue
+			}
+			sha1, err := writeNode(child)
+			if err != nil {
+				return "", err
+			}
+			raw, err := sha1Bytes(sha1)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&buf, "40000 %s\x00", name)
+			buf.Write(raw)
+		}
+		return WriteObject(c, "tree", buf.Bytes())
+	}
+	return writeNode(root)
+}
+
+// sha1Bytes decodes sha1's 40-character hex form into the 20 raw
+// bytes a tree object's entries actually store.
+func sha1Bytes(sha1 Sha1) ([]byte, error) {
+	return hex.DecodeString(string(sha1))
+}
+
+// writeCommitObject writes a commit object from already-resolved
+// parent Sha1s and raw author/committer lines (as found verbatim in
+// the fast-import stream).
+func writeCommitObject(c *Client, tree Sha1, parents []Sha1, author, committer string, message []byte) (Sha1, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "tree %s\n", tree)
+	for _, p := range parents {
+		fmt.Fprintf(&buf, "parent %s\n", p)
+	}
+	fmt.Fprintf(&buf, "author %s\ncommitter %s\n\n", author, committer)
+	buf.Write(message)
+	buf.WriteByte('\n')
+	return WriteObject(c, "commit", buf.Bytes())
+}
@@ -0,0 +1,195 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// GeneratePatch renders diffs as a unified patch to w. Each file goes
+// through the same pipeline upstream does: a line-level diff between
+// the old and new content, the indent heuristic (SlideHunks) sliding
+// each change group to its most readable position when
+// opt.IndentHeuristic is set, and finally hunk rendering with
+// opt.NumContextLines lines of context around each change.
+func GeneratePatch(c *Client, opt DiffCommonOptions, diffs []HashDiff, w io.Writer) error {
+	for _, d := range diffs {
+		if err := generateFilePatch(c, opt, d, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateFilePatch renders a single file's hunks to w, or nothing if
+// the two sides came out identical.
+func generateFilePatch(c *Client, opt DiffCommonOptions, d HashDiff, w io.Writer) error {
+	oldContent, err := blobContent(c, d.Src, d.Name, false)
+	if err != nil {
+		return err
+	}
+	newContent, err := blobContent(c, d.Dst, d.Name, true)
+	if err != nil {
+		return err
+	}
+	oldLines := splitLines(oldContent)
+	newLines := splitLines(newContent)
+
+	groups := diffGroups(oldLines, newLines)
+	if opt.IndentHeuristic {
+		groups = applyIndentHeuristic(oldLines, newLines, groups)
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	src, dst := opt.SrcPrefix, opt.DstPrefix
+	if src == "" {
+		src = "a/"
+	}
+	if dst == "" {
+		dst = "b/"
+	}
+
+	fmt.Fprintf(w, "diff --git %s%s %s%s\n", src, d.Name, dst, d.Name)
+	fmt.Fprintf(w, "--- %s%s\n", src, d.Name)
+	fmt.Fprintf(w, "+++ %s%s\n", dst, d.Name)
+	for i := range groups {
+		renderHunk(w, oldLines, newLines, groups, i, opt.NumContextLines)
+	}
+	return nil
+}
+
+// blobContent reads sha1's object content, or, if sha1 is empty and
+// useWorkingTree is set (the new side of a diff against the working
+// tree, which has no object until it's added), the path's current
+// on-disk content. An empty sha1 with useWorkingTree false means the
+// path doesn't exist on that side at all.
+func blobContent(c *Client, sha1 Sha1, path File, useWorkingTree bool) ([]byte, error) {
+	if sha1 == "" {
+		if !useWorkingTree {
+			return nil, nil
+		}
+		content, err := ioutil.ReadFile(path.String())
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return content, err
+	}
+	_, content, err := c.GetObject(sha1)
+	return content, err
+}
+
+// splitLines splits content into lines, each still carrying its
+// trailing "\n" (so hunk rendering can print them back out verbatim),
+// without the empty trailing element strings.SplitAfter leaves behind
+// when content itself ends in the separator.
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// hunkGroup is a single contiguous change between oldLines and
+// newLines: the [oldStart,oldEnd) run removed and the
+// [newStart,newEnd) run added in its place. A pure insert has
+// oldStart == oldEnd; a pure delete has newStart == newEnd.
+type hunkGroup struct {
+	oldStart, oldEnd int
+	newStart, newEnd int
+}
+
+// diffGroups finds every run of lines between oldLines and newLines
+// that isn't part of their longest common subsequence, by reusing the
+// same line-alignment lcsMatch-based machinery RerereRecord uses to
+// map a resolved file back onto its preimage.
+func diffGroups(oldLines, newLines []string) []hunkGroup {
+	pairs := alignMatchedLines(linesToTokens(oldLines), linesToTokens(newLines))
+
+	var groups []hunkGroup
+	oi, ni := 0, 0
+	for _, p := range pairs {
+		if p[0] > oi || p[1] > ni {
+			groups = append(groups, hunkGroup{oldStart: oi, oldEnd: p[0], newStart: ni, newEnd: p[1]})
+		}
+		oi, ni = p[0]+1, p[1]+1
+	}
+	if oi < len(oldLines) || ni < len(newLines) {
+		groups = append(groups, hunkGroup{oldStart: oi, oldEnd: len(oldLines), newStart: ni, newEnd: len(newLines)})
+	}
+	return groups
+}
+
+// applyIndentHeuristic slides each pure-insert or pure-delete group to
+// the best position in its sliding window via SlideHunks, shifting
+// its (empty) range on the other side by the same amount: since the
+// group's boundaries sit on lines common to both files, that context
+// slides with it on both sides alike. Replace groups (both sides
+// non-empty) aren't slid, matching upstream's heuristic.
+func applyIndentHeuristic(oldLines, newLines []string, groups []hunkGroup) []hunkGroup {
+	out := make([]hunkGroup, len(groups))
+	for i, g := range groups {
+		switch {
+		case g.oldStart == g.oldEnd && g.newEnd > g.newStart:
+			slid := SlideHunks(newLines, []ChangeGroup{{Start: g.newStart, End: g.newEnd}})[0]
+			delta := slid.Start - g.newStart
+			out[i] = hunkGroup{oldStart: g.oldStart + delta, oldEnd: g.oldEnd + delta, newStart: slid.Start, newEnd: slid.End}
+		case g.newStart == g.newEnd && g.oldEnd > g.oldStart:
+			slid := SlideHunks(oldLines, []ChangeGroup{{Start: g.oldStart, End: g.oldEnd}})[0]
+			delta := slid.Start - g.oldStart
+			out[i] = hunkGroup{oldStart: slid.Start, oldEnd: slid.End, newStart: g.newStart + delta, newEnd: g.newEnd + delta}
+		default:
+			out[i] = g
+		}
+	}
+	return out
+}
+
+// renderHunk writes groups[i] as a single "@@ ... @@" hunk, with up to
+// context lines of unchanged context on each side, clamped so it
+// never reaches into a neighbouring group's own changed lines.
+func renderHunk(w io.Writer, oldLines, newLines []string, groups []hunkGroup, i, context int) {
+	g := groups[i]
+
+	oldLo := g.oldStart - context
+	if i > 0 && oldLo < groups[i-1].oldEnd {
+		oldLo = groups[i-1].oldEnd
+	}
+	if oldLo < 0 {
+		oldLo = 0
+	}
+	oldHi := g.oldEnd + context
+	if i < len(groups)-1 && oldHi > groups[i+1].oldStart {
+		oldHi = groups[i+1].oldStart
+	}
+	if oldHi > len(oldLines) {
+		oldHi = len(oldLines)
+	}
+
+	// The context window is the same span of common lines on both
+	// sides, just offset by however far the old/new ranges have
+	// already diverged at g's boundaries.
+	newLo := g.newStart - (g.oldStart - oldLo)
+	newHi := g.newEnd + (oldHi - g.oldEnd)
+
+	fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", oldLo+1, oldHi-oldLo, newLo+1, newHi-newLo)
+	for i := oldLo; i < g.oldStart; i++ {
+		fmt.Fprintf(w, " %s", oldLines[i])
+	}
+	for i := g.oldStart; i < g.oldEnd; i++ {
+		fmt.Fprintf(w, "-%s", oldLines[i])
+	}
+	for i := g.newStart; i < g.newEnd; i++ {
+		fmt.Fprintf(w, "+%s", newLines[i])
+	}
+	for i := g.oldEnd; i < oldHi; i++ {
+		fmt.Fprintf(w, " %s", oldLines[i])
+	}
+}
@@ -0,0 +1,21 @@
+package git
+
+import "strings"
+
+// IsChild reports whether f is inside the directory named by dir (ie.
+// dir is a path prefix of f on a "/" boundary).
+func (f File) IsChild(dir File) bool {
+	return strings.HasPrefix(string(f), string(dir)+"/")
+}
+
+// MatchesAny reports whether f is equal to, or a descendant of, any
+// of the given pathspecs. It's used to decide whether a commit
+// touches any of the paths "log <paths>..." was restricted to.
+func (f File) MatchesAny(paths []File) bool {
+	for _, p := range paths {
+		if f == p || f.IsChild(p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package git
+
+// Rename describes a single rename pairing found by RenameDetect: the
+// blob at Src in the "before" side was, with at least Similarity
+// confidence, renamed to Dst in the "after" side.
+type Rename struct {
+	Src        File
+	Dst        File
+	Similarity float64
+}
+
+// similarityChunkSize is the block size, in bytes, used to estimate
+// blob similarity without doing a full line-by-line diff.
+const similarityChunkSize = 8
+
+// RenameDetect pairs up blobs that only exist on one side of a tree
+// comparison (ie. were deleted on one side and added on the other) by
+// a size+hash similarity heuristic, and reports any pair whose
+// similarity is at or above threshold (0-1) as a rename. Each entry
+// in removed/added is used at most once, and unmatched entries are
+// silently dropped: callers should report those as plain adds/deletes.
+//
+// Its caller is "log --follow", which uses it to find the name a
+// followed path had before it was renamed.
+func RenameDetect(c *Client, removed, added []TreeEntry, threshold float64) ([]Rename, error) {
+	used := make([]bool, len(removed))
+	var renames []Rename
+	for _, a := range added {
+		best := -1
+		var bestScore float64
+		for i, r := range removed {
+			if used[i] {
+				continue
+			}
+			score, err := blobSimilarity(c, r.Sha1, a.Sha1)
+			if err != nil {
+				return nil, err
+			}
+			if score > bestScore {
+				bestScore = score
+				best = i
+			}
+		}
+		if best >= 0 && bestScore >= threshold {
+			used[best] = true
+			renames = append(renames, Rename{Src: removed[best].File, Dst: a.File, Similarity: bestScore})
+		}
+	}
+	return renames, nil
+}
+
+// blobSimilarity estimates how similar two blobs are without a full
+// line-by-line diff: it reads both blobs and compares the fraction of
+// matching fixed-size chunks between them.
+func blobSimilarity(c *Client, a, b Sha1) (float64, error) {
+	if a == b {
+		return 1.0, nil
+	}
+	_, acontent, err := c.GetObject(a)
+	if err != nil {
+		return 0, err
+	}
+	_, bcontent, err := c.GetObject(b)
+	if err != nil {
+		return 0, err
+	}
+	return chunkSimilarity(acontent, bcontent), nil
+}
+
+// chunkSimilarity splits both slices into similarityChunkSize-byte
+// chunks and returns the fraction of chunks from the smaller blob
+// that also occur somewhere in the larger one.
+func chunkSimilarity(a, b []byte) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1.0
+	}
+	if len(a) == 0 || len(b) == 0 {
+		return 0.0
+	}
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+
+	chunks := make(map[string]int)
+	for i := 0; i+similarityChunkSize <= len(b); i += similarityChunkSize {
+		chunks[string(b[i:i+similarityChunkSize])]++
+	}
+
+	var matched, total int
+	for i := 0; i+similarityChunkSize <= len(a); i += similarityChunkSize {
+		total++
+		k := string(a[i : i+similarityChunkSize])
+		if chunks[k] > 0 {
+			matched++
+			chunks[k]--
+		}
+	}
+	if total == 0 {
+		// The smaller blob is shorter than a single chunk; fall back to a
+		// straight size ratio as the similarity estimate.
+		small, big := len(a), len(b)
+		return float64(small) / float64(big)
+	}
+	return float64(matched) / float64(total)
+}
+
+// ChangedPaths returns the blobs that were removed and added going
+// from parent's tree to cmt's tree, restricted to paths if it's
+// non-empty. A zero-value parent is treated as an empty tree, so
+// every blob cmt contains (under paths) is reported as added.
+func ChangedPaths(c *Client, cmt, parent CommitID, paths []File) (removed, added []TreeEntry, err error) {
+	toEntries, err := lsTreeRecursive(c, cmt, paths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var fromEntries []TreeEntry
+	if parent != "" {
+		fromEntries, err = lsTreeRecursive(c, parent, paths)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	from := make(map[File]Sha1, len(fromEntries))
+	for _, e := range fromEntries {
+		from[e.File] = e.Sha1
+	}
+	to := make(map[File]Sha1, len(toEntries))
+	for _, e := range toEntries {
+		to[e.File] = e.Sha1
+	}
+
+	for _, e := range fromEntries {
+		if sha1, ok := to[e.File]; !ok || sha1 != e.Sha1 {
+			removed = append(removed, e)
+		}
+	}
+	for _, e := range toEntries {
+		if sha1, ok := from[e.File]; !ok || sha1 != e.Sha1 {
+			added = append(added, e)
+		}
+	}
+	return removed, added, nil
+}
+
+// lsTreeRecursive flattens cmt's tree into a list of blob entries,
+// restricted to paths if it's non-empty.
+func lsTreeRecursive(c *Client, cmt CommitID, paths []File) ([]TreeEntry, error) {
+	tree, err := cmt.TreeID(c)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := tree.Entries(c, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return entries, nil
+	}
+	var filtered []TreeEntry
+	for _, e := range entries {
+		for _, p := range paths {
+			if e.File == p || e.File.IsChild(p) {
+				filtered = append(filtered, e)
+				break
+			}
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,526 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	conflictMarkerOurs   = "<<<<<<<"
+	conflictMarkerBase   = "|||||||"
+	conflictMarkerTheirs = "======="
+	conflictMarkerEnd    = ">>>>>>>"
+)
+
+// RerereID identifies a recorded conflict resolution: the SHA-1 of a
+// single conflict hunk's normalized preimage.
+type RerereID string
+
+// conflictHunk is a single "<<<<<<<"..">>>>>>>" region found in a
+// conflicted file: the lines of its "ours" and "theirs" sides.
+type conflictHunk struct {
+	ours, theirs []string
+}
+
+// hunkTrack is what MERGE_RR remembers about one conflict hunk between
+// the RerereResolve call that found it and the RerereRecord call that
+// captures its resolution: the cache entry it was filed under, and the
+// [start,end) line range (into the whole file, as split on "\n", at
+// the time of that RerereResolve call) it occupied.
+type hunkTrack struct {
+	id         RerereID
+	start, end int
+}
+
+// rerereEnabled reports whether the rerere mechanism should run at
+// all for c, per the rerere.enabled config variable. It defaults to
+// on, matching upstream once an rr-cache directory exists, but dgit
+// always defaults it on since there's no cheap way to detect "this
+// repo has used rerere before" without one.
+func rerereEnabled(c *Client) bool {
+	v, _ := c.GetConfig("rerere.enabled")
+	return v != "false"
+}
+
+// rerereAutoupdate reports whether a resolution applied from the
+// cache should also be staged, per rerere.autoupdate. It defaults to
+// off, matching upstream. The recorded resolution is always written
+// to the working tree copy of the file regardless of this setting;
+// upstream only gates the extra step of staging it. RerereResolve
+// reads this setting but never stages the file, whatever its value.
+func rerereAutoupdate(c *Client) bool {
+	v, _ := c.GetConfig("rerere.autoupdate")
+	return v == "true"
+}
+
+// rrCacheDir returns the root of the rr-cache directory, creating it
+// if it doesn't exist yet.
+func rrCacheDir(c *Client) (string, error) {
+	dir := filepath.Join(c.GitDir.String(), "rr-cache")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// splitConflicts scans content for "<<<<<<<"/"======="/">>>>>>>"
+// conflict hunks and returns them in order.
+func splitConflicts(content []byte) []conflictHunk {
+	hunks, _ := splitConflictsIndexed(content)
+	return hunks
+}
+
+// splitConflictsIndexed is splitConflicts, plus the [start,end) range
+// (into strings.Split(content, "\n"), from the "<<<<<<<" line up to
+// and including the ">>>>>>>" line) each hunk occupies, so a caller
+// can substitute a resolution back into the file without touching any
+// other hunk or unconflicted content.
+func splitConflictsIndexed(content []byte) (hunks []conflictHunk, ranges [][2]int) {
+	lines := strings.Split(string(content), "\n")
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], conflictMarkerOurs) {
+			continue
+		}
+		start := i
+		var h conflictHunk
+		i++
+		for i < len(lines) && !strings.HasPrefix(lines[i], conflictMarkerBase) && !strings.HasPrefix(lines[i], conflictMarkerTheirs) {
+			h.ours = append(h.ours, lines[i])
+			i++
+		}
+		if i < len(lines) && strings.HasPrefix(lines[i], conflictMarkerBase) {
+			// Skip the merge-base side; rerere only records ours/theirs.
+			i++
+			for i < len(lines) && !strings.HasPrefix(lines[i], conflictMarkerTheirs) {
+				i++
+			}
+		}
+		if i < len(lines) && strings.HasPrefix(lines[i], conflictMarkerTheirs) {
+			i++
+		}
+		for i < len(lines) && !strings.HasPrefix(lines[i], conflictMarkerEnd) {
+			h.theirs = append(h.theirs, lines[i])
+			i++
+		}
+		end := i
+		if i < len(lines) {
+			end = i + 1 // include the ">>>>>>>" line itself
+		}
+		hunks = append(hunks, h)
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return hunks, ranges
+}
+
+// normalizePreimage renders a single hunk in the canonical form rerere
+// hashes and stores: markers with no trailing label text, and the two
+// sides sorted lexicographically so that a conflict and its mirror
+// image (ours/theirs swapped, eg. from the other branch) map to the
+// same id.
+func normalizePreimage(h conflictHunk) []byte {
+	ours := strings.Join(h.ours, "\n")
+	theirs := strings.Join(h.theirs, "\n")
+	sides := []string{ours, theirs}
+	sort.Strings(sides)
+
+	var buf bytes.Buffer
+	buf.WriteString(conflictMarkerOurs + "\n")
+	buf.WriteString(sides[0])
+	buf.WriteString("\n" + conflictMarkerTheirs + "\n")
+	buf.WriteString(sides[1])
+	buf.WriteString("\n" + conflictMarkerEnd + "\n")
+	return buf.Bytes()
+}
+
+// rerereIDFor computes the RerereID of a single conflict hunk.
+func rerereIDFor(h conflictHunk) (id RerereID, normalized []byte) {
+	normalized = normalizePreimage(h)
+	sum := sha1.Sum(normalized)
+	return RerereID(fmt.Sprintf("%x", sum)), normalized
+}
+
+// mergeRRPath is where the tracked hunks of each currently-conflicted
+// path are recorded between RerereResolve and RerereRecord, mirroring
+// upstream's .git/MERGE_RR.
+func mergeRRPath(c *Client) string {
+	return filepath.Join(c.GitDir.String(), "MERGE_RR")
+}
+
+// readMergeRR loads the path -> tracked-hunks mapping left behind by
+// the most recent RerereResolve call. Hunks are returned in the order
+// they appear in the file.
+func readMergeRR(c *Client) (map[File][]hunkTrack, error) {
+	content, err := ioutil.ReadFile(mergeRRPath(c))
+	if os.IsNotExist(err) {
+		return map[File][]hunkTrack{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	m := make(map[File][]hunkTrack)
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "\t", 4)
+		if len(parts) != 4 {
+			continue
+		}
+		var start, end int
+		if _, err := fmt.Sscanf(parts[2]+" "+parts[3], "%d %d", &start, &end); err != nil {
+			continue
+		}
+		f := File(parts[1])
+		m[f] = append(m[f], hunkTrack{id: RerereID(parts[0]), start: start, end: end})
+	}
+	return m, nil
+}
+
+// writeMergeRR persists the path -> tracked-hunks mapping for the
+// next RerereRecord call.
+func writeMergeRR(c *Client, m map[File][]hunkTrack) error {
+	var buf bytes.Buffer
+	for f, hunks := range m {
+		for _, h := range hunks {
+			fmt.Fprintf(&buf, "%s\t%s\t%d\t%d\n", h.id, f, h.start, h.end)
+		}
+	}
+	return ioutil.WriteFile(mergeRRPath(c), buf.Bytes(), 0644)
+}
+
+// origStashPath is where RerereResolve stashes the whole conflicted
+// file as it last saw it, so RerereRecord can diff the resolution
+// against it to work out which lines replaced which hunk.
+func origStashPath(c *Client, f File) string {
+	return filepath.Join(c.GitDir.String(), "rr-cache", ".orig", strings.ReplaceAll(string(f), "/", "_"))
+}
+
+// RerereResolve scans files for unresolved conflicts and, for each
+// hunk found, records its preimage under .git/rr-cache/<id>/ and notes
+// the id and the hunk's line range against that path in
+// .git/MERGE_RR for RerereRecord to pick up later. If a postimage was
+// already recorded for that id (ie. this exact conflict, or its
+// mirror image, was resolved before), it's spliced into the working
+// tree copy of the file in place of just that hunk, leaving the rest
+// of the file - including any other hunk - untouched. Files with no
+// conflict markers are skipped.
+func RerereResolve(c *Client, files []File) error {
+	if !rerereEnabled(c) {
+		return nil
+	}
+	cache, err := rrCacheDir(c)
+	if err != nil {
+		return err
+	}
+	tracked, err := readMergeRR(c)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		content, err := ioutil.ReadFile(f.String())
+		if err != nil {
+			continue
+		}
+		hunks, ranges := splitConflictsIndexed(content)
+		if len(hunks) == 0 {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(origStashPath(c, f)), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(origStashPath(c, f), content, 0644); err != nil {
+			return err
+		}
+
+		lines := strings.Split(string(content), "\n")
+		var tracks []hunkTrack
+		offset := 0
+		changed := false
+		for k, h := range hunks {
+			id, normalized := rerereIDFor(h)
+			tracks = append(tracks, hunkTrack{id: id, start: ranges[k][0], end: ranges[k][1]})
+
+			dir := filepath.Join(cache, string(id))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, "preimage"), normalized, 0644); err != nil {
+				return err
+			}
+			thisimage := strings.Join(lines[ranges[k][0]+offset:ranges[k][1]+offset], "\n")
+			if err := ioutil.WriteFile(filepath.Join(dir, "thisimage"), []byte(thisimage), 0644); err != nil {
+				return err
+			}
+
+			post, err := ioutil.ReadFile(filepath.Join(dir, "postimage"))
+			if err != nil {
+				// No recorded resolution yet; leave the conflict for
+				// the user to resolve by hand.
+				continue
+			}
+			resolved := strings.Split(string(post), "\n")
+			start, end := ranges[k][0]+offset, ranges[k][1]+offset
+			lines = append(append(append([]string{}, lines[:start]...), resolved...), lines[end:]...)
+			offset += len(resolved) - (end - start)
+			changed = true
+		}
+		tracked[f] = tracks
+
+		if changed {
+			if err := ioutil.WriteFile(f.String(), []byte(strings.Join(lines, "\n")), 0644); err != nil {
+				return err
+			}
+			// rerere.autoupdate additionally stages the resolved file;
+			// there's no "write a single path to the index" primitive
+			// in this tree yet to hang that on, so for now the applied
+			// resolution is always left for the user (or a later
+			// "git add") to stage.
+			_ = rerereAutoupdate(c)
+		}
+	}
+	return writeMergeRR(c, tracked)
+}
+
+// RerereRecord captures the user's resolution of conflicts that
+// RerereResolve previously tracked: for each tracked path that no
+// longer contains conflict markers, the stashed pre-resolution copy
+// of the file is aligned against its current contents (by matching
+// the lines common to both) to work out which lines replaced which
+// tracked hunk, and that slice is saved as the hunk's postimage so
+// future identical conflicts resolve automatically. The path is then
+// dropped from MERGE_RR.
+func RerereRecord(c *Client, files []File) error {
+	if !rerereEnabled(c) {
+		return nil
+	}
+	cache, err := rrCacheDir(c)
+	if err != nil {
+		return err
+	}
+	tracked, err := readMergeRR(c)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		hunks, ok := tracked[f]
+		if !ok {
+			continue
+		}
+		content, err := ioutil.ReadFile(f.String())
+		if err != nil {
+			continue
+		}
+		if h, _ := splitConflictsIndexed(content); len(h) > 0 {
+			// Still conflicted; nothing to record yet.
+			continue
+		}
+
+		orig, err := ioutil.ReadFile(origStashPath(c, f))
+		if err != nil {
+			continue
+		}
+		origLines := strings.Split(string(orig), "\n")
+		newLines := strings.Split(string(content), "\n")
+		pairs := alignMatchedLines(linesToTokens(origLines), linesToTokens(newLines))
+
+		for _, t := range hunks {
+			newStart, newEnd := resolvedRange(pairs, t.start, t.end, len(newLines))
+			post := strings.Join(newLines[newStart:newEnd], "\n")
+
+			dir := filepath.Join(cache, string(t.id))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, "postimage"), []byte(post), 0644); err != nil {
+				return err
+			}
+		}
+		delete(tracked, f)
+		os.Remove(origStashPath(c, f))
+	}
+	return writeMergeRR(c, tracked)
+}
+
+// linesToTokens adapts a file's lines to lcsMatch's token type, so
+// line-level alignment can reuse the same LCS machinery word-diff
+// highlighting uses at the word level.
+func linesToTokens(lines []string) []wordDiffToken {
+	toks := make([]wordDiffToken, len(lines))
+	for i, l := range lines {
+		toks[i] = wordDiffToken{text: l}
+	}
+	return toks
+}
+
+// alignMatchedLines pairs up the lines lcsMatch considers part of the
+// longest common subsequence of a and b, in document order. Matched
+// lines appear in the same relative order on both sides, so a single
+// two-pointer walk over the two "is this index matched" arrays
+// recovers the pairing without re-comparing line text.
+func alignMatchedLines(a, b []wordDiffToken) [][2]int {
+	matchedA, matchedB := lcsMatch(a, b)
+	var pairs [][2]int
+	i, j := 0, 0
+	for i < len(matchedA) && j < len(matchedB) {
+		switch {
+		case !matchedA[i]:
+			i++
+		case !matchedB[j]:
+			j++
+		default:
+			pairs = append(pairs, [2]int{i, j})
+			i++
+			j++
+		}
+	}
+	return pairs
+}
+
+// resolvedRange maps a hunk's [start,end) line range in the original
+// (still-conflicted) file to the range of lines in the resolved file
+// that replaced it: the stretch between whatever common line
+// immediately precedes start and whatever common line immediately
+// follows end.
+func resolvedRange(pairs [][2]int, start, end, newLen int) (int, int) {
+	newStart, newEnd := 0, newLen
+	for _, p := range pairs {
+		if p[0] < start {
+			newStart = p[1] + 1
+		}
+		if p[0] >= end {
+			newEnd = p[1]
+			break
+		}
+	}
+	return newStart, newEnd
+}
+
+// RerereTracked returns every path RerereResolve is currently
+// tracking, mapped to whether it's still conflicted in the working
+// tree (false) or has been resolved and is just waiting for
+// RerereRecord to run (true).
+func RerereTracked(c *Client) (map[File]bool, error) {
+	tracked, err := readMergeRR(c)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[File]bool, len(tracked))
+	for f := range tracked {
+		content, err := ioutil.ReadFile(f.String())
+		if err != nil {
+			result[f] = false
+			continue
+		}
+		hunks, _ := splitConflictsIndexed(content)
+		result[f] = len(hunks) == 0
+	}
+	return result, nil
+}
+
+// RerereDiff renders, for each tracked hunk, a "---"/"+++" header pair
+// followed by the recorded preimage in full and then the file's
+// current contents in full. No line-level diff between the two is
+// computed.
+func RerereDiff(c *Client) ([]string, error) {
+	cache, err := rrCacheDir(c)
+	if err != nil {
+		return nil, err
+	}
+	tracked, err := readMergeRR(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for f, hunks := range tracked {
+		cur, err := ioutil.ReadFile(f.String())
+		if err != nil {
+			continue
+		}
+		for _, h := range hunks {
+			pre, err := ioutil.ReadFile(filepath.Join(cache, string(h.id), "preimage"))
+			if err != nil {
+				continue
+			}
+			out = append(out, fmt.Sprintf("--- a/%s (recorded conflict)\n+++ b/%s (working tree)\n%s\n%s\n",
+				f, f, pre, cur))
+		}
+	}
+	return out, nil
+}
+
+// RerereForget drops the rr-cache entries referenced by files (or
+// every tracked entry, if files is empty) and removes them from
+// MERGE_RR so they're recorded from scratch the next time they
+// conflict.
+func RerereForget(c *Client, files []File) error {
+	cache, err := rrCacheDir(c)
+	if err != nil {
+		return err
+	}
+	tracked, err := readMergeRR(c)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		for f := range tracked {
+			files = append(files, f)
+		}
+	}
+	for _, f := range files {
+		hunks, ok := tracked[f]
+		if !ok {
+			continue
+		}
+		for _, h := range hunks {
+			if err := os.RemoveAll(filepath.Join(cache, string(h.id))); err != nil {
+				return err
+			}
+		}
+		os.Remove(origStashPath(c, f))
+		delete(tracked, f)
+	}
+	return writeMergeRR(c, tracked)
+}
+
+// RerereGC removes rr-cache entries that haven't been touched in
+// maxAgeDays days. maxAgeDays <= 0 means "clear everything", matching
+// "dgit rerere clear".
+func RerereGC(c *Client, maxAgeDays int) error {
+	cache, err := rrCacheDir(c)
+	if err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(cache)
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -maxAgeDays)
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == ".orig" {
+			continue
+		}
+		dir := filepath.Join(cache, e.Name())
+		if maxAgeDays > 0 {
+			info, err := os.Stat(filepath.Join(dir, "preimage"))
+			if err == nil && info.ModTime().After(cutoff) {
+				continue
+			}
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package git
+
+// WalkCommitsTopo returns every commit reachable from start exactly
+// once, ordered so that a commit always comes after all of its
+// parents. That's the order fast-export (and anything else that has
+// to emit objects before whatever references them) needs; "log"'s
+// own parent-first, most-recent-first walk is a different traversal
+// over the same DAG.
+func WalkCommitsTopo(c *Client, start CommitID) ([]CommitID, error) {
+	visited := make(map[CommitID]bool)
+	var order []CommitID
+
+	var visit func(CommitID) error
+	visit = func(cmt CommitID) error {
+		if visited[cmt] {
+			return nil
+		}
+		visited[cmt] = true
+		parents, err := cmt.Parents(c)
+		if err != nil {
+			return err
+		}
+		for _, p := range parents {
+			if err := visit(p); err != nil {
+				return err
+			}
+		}
+		order = append(order, cmt)
+		return nil
+	}
+
+	if err := visit(start); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
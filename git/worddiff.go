@@ -0,0 +1,314 @@
+package git
+
+import "strings"
+
+const (
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiReset = "\x1b[0m"
+)
+
+// wordDiffToken is a single token produced by tokenize: either a run
+// of word characters (letters, digits, underscore) or a single
+// character of punctuation or whitespace.
+type wordDiffToken struct {
+	text string
+	ws   bool
+}
+
+// tokenize splits a line into words (runs of letters/digits/_) and
+// single-character punctuation/whitespace tokens, for LCS-based
+// word-diff highlighting. The trailing newline, if present, becomes
+// its own whitespace token, so it's never considered "changed".
+func tokenize(line string) []wordDiffToken {
+	var toks []wordDiffToken
+	runes := []rune(line)
+	isWord := func(r rune) bool {
+		return r == '_' ||
+			(r >= '0' && r <= '9') ||
+			(r >= 'a' && r <= 'z') ||
+			(r >= 'A' && r <= 'Z')
+	}
+	for i := 0; i < len(runes); {
+		if isWord(runes[i]) {
+			j := i
+			for j < len(runes) && isWord(runes[j]) {
+				j++
+			}
+			toks = append(toks, wordDiffToken{text: string(runes[i:j])})
+			i = j
+			continue
+		}
+		r := runes[i]
+		toks = append(toks, wordDiffToken{
+			text: string(r),
+			ws:   r == ' ' || r == '\t' || r == '\n' || r == '\r',
+		})
+		i++
+	}
+	return toks
+}
+
+// lcsMatch returns, for each index of a and b respectively, whether
+// that token participates in the longest common subsequence of a and
+// b. Whitespace tokens never anchor a match: they're excluded from
+// the matching entirely, but still copied through to the rendered
+// output unchanged.
+func lcsMatch(a, b []wordDiffToken) (matchedA, matchedB []bool) {
+	var av, bv []string
+	var ai, bi []int
+	for i, t := range a {
+		if t.ws {
+			continue
+		}
+		av = append(av, t.text)
+		ai = append(ai, i)
+	}
+	for i, t := range b {
+		if t.ws {
+			continue
+		}
+		bv = append(bv, t.text)
+		bi = append(bi, i)
+	}
+
+	n, m := len(av), len(bv)
+	dp := make([][]int, n+1)
+	for i := range dp {
+		dp[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if av[i] == bv[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else if dp[i+1][j] >= dp[i][j+1] {
+				dp[i][j] = dp[i+1][j]
+			} else {
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+
+	matchedA = make([]bool, len(a))
+	matchedB = make([]bool, len(b))
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case av[i] == bv[j]:
+			matchedA[ai[i]] = true
+			matchedB[bi[j]] = true
+			i++
+			j++
+		case dp[i+1][j] >= dp[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return matchedA, matchedB
+}
+
+// WordDiffHighlight post-processes a rendered unified diff patch,
+// replacing each run of consecutive "-" lines immediately followed by
+// an equal-length run of "+" lines with a version that highlights the
+// differing word runs within each pair, instead of marking the whole
+// lines as changed. Runs of unequal length, and lines outside a hunk,
+// are passed through untouched.
+func WordDiffHighlight(patch string, opt DiffCommonOptions) string {
+	lines := strings.SplitAfter(patch, "\n")
+	var out strings.Builder
+	inHunk := false
+
+	isRemoval := func(l string) bool { return strings.HasPrefix(l, "-") && !strings.HasPrefix(l, "---") }
+	isAddition := func(l string) bool { return strings.HasPrefix(l, "+") && !strings.HasPrefix(l, "+++") }
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "@@") {
+			inHunk = true
+			out.WriteString(line)
+			continue
+		}
+		if !inHunk || !isRemoval(line) {
+			if strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "index ") {
+				inHunk = false
+			}
+			out.WriteString(line)
+			continue
+		}
+
+		start := i
+		for i < len(lines) && isRemoval(lines[i]) {
+			i++
+		}
+		removed := lines[start:i]
+
+		addStart := i
+		for i < len(lines) && isAddition(lines[i]) {
+			i++
+		}
+		added := lines[addStart:i]
+		i--
+
+		if len(removed) != len(added) || len(removed) == 0 {
+			for _, l := range removed {
+				out.WriteString(l)
+			}
+			for _, l := range added {
+				out.WriteString(l)
+			}
+			continue
+		}
+
+		for k := range removed {
+			out.WriteString(highlightPair(removed[k], added[k], opt))
+		}
+	}
+	return out.String()
+}
+
+// highlightPair renders one removed/added line pair according to
+// opt.WordDiff: plain and color keep git's usual two-line "-"/"+"
+// shape, each with its own non-matching word runs wrapped; porcelain
+// instead collapses the pair into upstream's single combined line,
+// since it's meant for a machine to parse context and changes out of
+// one line rather than diffing the two back against each other.
+func highlightPair(oldLine, newLine string, opt DiffCommonOptions) string {
+	oldToks := tokenize(strings.TrimPrefix(oldLine, "-"))
+	newToks := tokenize(strings.TrimPrefix(newLine, "+"))
+
+	mode := opt.WordDiff
+	if mode == WordDiffColor && !opt.Color {
+		mode = WordDiffPlain
+	}
+
+	if mode == WordDiffPorcelain {
+		oldTrim, oldNL := trimTrailingNewlineToken(oldToks)
+		newTrim, newNL := trimTrailingNewlineToken(newToks)
+		trail := newNL
+		if trail == "" {
+			trail = oldNL
+		}
+		return renderWordDiffCombined(oldTrim, newTrim) + trail
+	}
+
+	matchedOld, matchedNew := lcsMatch(oldToks, newToks)
+	var b strings.Builder
+	b.WriteString("-")
+	b.WriteString(renderWordDiffSide(oldToks, matchedOld, mode, true))
+	b.WriteString("+")
+	b.WriteString(renderWordDiffSide(newToks, matchedNew, mode, false))
+	return b.String()
+}
+
+// trimTrailingNewlineToken splits off tokenize's trailing "\n" token,
+// if present, so it can be re-appended after the rest of the line is
+// rendered instead of being treated as part of a changed run.
+func trimTrailingNewlineToken(toks []wordDiffToken) ([]wordDiffToken, string) {
+	if len(toks) > 0 && toks[len(toks)-1].text == "\n" {
+		return toks[:len(toks)-1], "\n"
+	}
+	return toks, ""
+}
+
+// renderWordDiffCombined renders oldToks/newToks as upstream's
+// "--word-diff=porcelain" does: one line, with the tokens common to
+// both sides printed once and each differing run printed as
+// "[-old-]{+new+}" in place, instead of two separate "-"/"+" lines.
+// It reuses the same matched-token alignment RerereRecord uses to map
+// a resolved file's lines back onto its preimage, just one level down
+// at the token granularity lcsMatch already operates at.
+func renderWordDiffCombined(oldToks, newToks []wordDiffToken) string {
+	pairs := alignMatchedLines(oldToks, newToks)
+
+	var b strings.Builder
+	oi, ni := 0, 0
+	for _, p := range pairs {
+		if p[0] > oi || p[1] > ni {
+			writeCombinedRun(&b, oldToks[oi:p[0]], newToks[ni:p[1]])
+		}
+		b.WriteString(oldToks[p[0]].text)
+		oi, ni = p[0]+1, p[1]+1
+	}
+	if oi < len(oldToks) || ni < len(newToks) {
+		writeCombinedRun(&b, oldToks[oi:], newToks[ni:])
+	}
+	return b.String()
+}
+
+// writeCombinedRun writes one differing stretch of a combined
+// porcelain line: the old side's tokens wrapped in "[-...-]", then
+// the new side's wrapped in "{+...+}", either omitted if its side is
+// empty (a pure insert or pure delete within the line). Whitespace
+// that both sides share at the front of the run, and a run whose two
+// sides are identical (whitespace lcsMatch skipped over), is common
+// text and is written once, unwrapped.
+func writeCombinedRun(b *strings.Builder, oldRun, newRun []wordDiffToken) {
+	for len(oldRun) > 0 && len(newRun) > 0 && oldRun[0].ws && oldRun[0] == newRun[0] {
+		b.WriteString(oldRun[0].text)
+		oldRun, newRun = oldRun[1:], newRun[1:]
+	}
+	if tokensText(oldRun) == tokensText(newRun) {
+		b.WriteString(tokensText(oldRun))
+		return
+	}
+	if old := tokensText(oldRun); old != "" {
+		b.WriteString("[-")
+		b.WriteString(old)
+		b.WriteString("-]")
+	}
+	if new := tokensText(newRun); new != "" {
+		b.WriteString("{+")
+		b.WriteString(new)
+		b.WriteString("+}")
+	}
+}
+
+func tokensText(toks []wordDiffToken) string {
+	var b strings.Builder
+	for _, t := range toks {
+		b.WriteString(t.text)
+	}
+	return b.String()
+}
+
+// renderWordDiffSide wraps consecutive unmatched, non-whitespace
+// tokens in the open/close markers for mode, leaving matched and
+// whitespace tokens untouched.
+func renderWordDiffSide(toks []wordDiffToken, matched []bool, mode WordDiffMode, removal bool) string {
+	open, close := wordDiffMarkers(mode, removal)
+
+	var b strings.Builder
+	inRun := false
+	for i, t := range toks {
+		changed := !t.ws && !matched[i]
+		if changed && !inRun {
+			b.WriteString(open)
+			inRun = true
+		} else if !changed && inRun {
+			b.WriteString(close)
+			inRun = false
+		}
+		b.WriteString(t.text)
+	}
+	if inRun {
+		b.WriteString(close)
+	}
+	return b.String()
+}
+
+func wordDiffMarkers(mode WordDiffMode, removal bool) (open, close string) {
+	if mode == WordDiffColor {
+		if removal {
+			return ansiRed, ansiReset
+		}
+		return ansiGreen, ansiReset
+	}
+	if removal {
+		return "[-", "-]"
+	}
+	return "{+", "+}"
+}